@@ -5,27 +5,64 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
 )
 
 type unescapeCallback func(string, *bytes.Buffer) bool
 type unwrapCallback func(string) string
 
 type ParserOptions struct {
-	VariableRegex  string
-	EscapeRegex    string
-	Unescape       unescapeCallback
+	VariableRegex string
+	EscapeRegex   string
+	Unescape      unescapeCallback
+	// UnwrapVariable strips the format's variable syntax down to a bare name (e.g.
+	// "{name}" -> "name"). A name ending in "*" after unwrapping, e.g. "{name*}",
+	// marks that variable's separator as greedy: it matches the last occurrence
+	// before the next anchoring separator instead of the first, so formats like
+	// "{path*} {query}?{fragment}" let path consume as much as possible.
 	UnwrapVariable unwrapCallback
+
+	// MaxScanTokenSize bounds the per-line buffer used by ParseStream. Zero keeps
+	// bufio.Scanner's default (64KB), which is plenty unless logs carry very long lines.
+	MaxScanTokenSize int
+
+	// Converters maps a variable name to a function that parses its string value into
+	// a typed value (timestamp, int, IP, ...). A converter only takes effect when the
+	// ParserResultStorage passed to Parse also implements TypedStorage; otherwise the
+	// value is stored as a plain string, as if no converter were registered.
+	Converters map[string]ValueConverter
+}
+
+// ValueConverter parses a variable's raw string value into a typed value.
+type ValueConverter func(string) (interface{}, error)
+
+// TypedStorage is an optional extension to ParserResultStorage. When a
+// ParserResultStorage implements it and a ValueConverter is registered for a
+// variable, Parse stores the converted value via StoreTyped instead of Store.
+type TypedStorage interface {
+	StoreTyped(key string, value interface{})
 }
 
 type Parser struct {
 	escapeRE         *regexp.Regexp
 	segments         []*parserSegment
 	unescapeCallback unescapeCallback
+
+	// regexParse, when non-nil, is used in place of the segment pipeline above. It is
+	// populated by NewRegexParser and holds the compiled named-capture expression plus
+	// the subexpression names reported by SubexpNames (kept so we don't recompute them
+	// on every call to Parse).
+	regexParse *regexp.Regexp
+	regexNames []string
+
+	maxScanTokenSize int
+	converters       map[string]ValueConverter
 }
 
 type parserSegment struct {
 	variable string
 	searcher *stringSearcher
+	greedy   bool
 }
 
 type ParserResultStorage interface {
@@ -73,13 +110,15 @@ func NewParser(format string, options *ParserOptions) (*Parser, error) {
 			}
 
 			varname := variable
+			greedy := false
 			if variable != "" {
-				varname = options.UnwrapVariable(variable)
+				varname, greedy = unwrapGreedy(options.UnwrapVariable(variable))
 			}
 
 			psegments = append(psegments, &parserSegment{
 				variable: varname,
 				searcher: searcher,
+				greedy:   greedy,
 			})
 
 			variable = ""
@@ -87,9 +126,12 @@ func NewParser(format string, options *ParserOptions) (*Parser, error) {
 	}
 
 	if variable != "" {
-		// If we ended with a variable, then add a parser segment for it.
+		// If we ended with a variable, then add a parser segment for it. It has no
+		// separator to search for, so a trailing "*" has no effect; strip it anyway
+		// so it doesn't leak into the stored variable name.
+		varname, _ := unwrapGreedy(options.UnwrapVariable(variable))
 		psegments = append(psegments, &parserSegment{
-			variable: options.UnwrapVariable(variable),
+			variable: varname,
 			searcher: nil,
 		})
 	}
@@ -98,9 +140,52 @@ func NewParser(format string, options *ParserOptions) (*Parser, error) {
 		escapeRE:         escRE,
 		segments:         psegments,
 		unescapeCallback: options.Unescape,
+		maxScanTokenSize: options.MaxScanTokenSize,
+		converters:       options.Converters,
 	}, nil
 }
 
+// unwrapGreedy splits a "*"-suffixed variable name, e.g. "name*", into its bare name
+// and whether it was marked greedy.
+func unwrapGreedy(varname string) (string, bool) {
+	if strings.HasSuffix(varname, "*") {
+		return strings.TrimSuffix(varname, "*"), true
+	}
+
+	return varname, false
+}
+
+// NewRegexParser builds a Parser around a single RE2 expression with named capture
+// groups (`(?P<name>...)`) instead of the variable/separator format string used by
+// NewParser. It trades the speed of the Boyer-Moore segment pipeline for the
+// expressiveness of a real regex engine, which is useful for irregular log shapes
+// (optional fields, alternation) that don't fit the `{var}sep{var}` grammar.
+//
+// options is nilable, since none of its fields are required in regex mode: only
+// Converters and MaxScanTokenSize apply (there's no variable/separator format string
+// to compile, so VariableRegex, EscapeRegex, Unescape and UnwrapVariable are unused).
+// Parsers built this way share the same ParserResultStorage interface as ones built
+// with NewParser, so downstream consumers don't need to know which mode produced a
+// given result.
+func NewRegexParser(pattern string, options *ParserOptions) (*Parser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &Parser{
+		regexParse: re,
+		regexNames: re.SubexpNames(),
+	}
+
+	if options != nil {
+		parser.converters = options.Converters
+		parser.maxScanTokenSize = options.MaxScanTokenSize
+	}
+
+	return parser, nil
+}
+
 func splitSegments(format string, varRE *regexp.Regexp) []string {
 	var segments []string
 
@@ -123,12 +208,16 @@ func splitSegments(format string, varRE *regexp.Regexp) []string {
 }
 
 func (parser *Parser) Parse(line string, output ParserResultStorage) error {
+	if parser.regexParse != nil {
+		return parser.parseRegex(line, output)
+	}
+
 	// First, find all of the escape sequences in the input so we can skip over them
 	// when processing the line.
 	escapes := parser.escapeRE.FindAllStringIndex(line, -1)
 
 	ptr := 0
-	for _, segment := range parser.segments {
+	for i, segment := range parser.segments {
 		if segment.variable == "" {
 			// Look for a delimiter at the beginning, don't read into a variable
 			_, eidx, escidx, err := segment.searcher.Search(line, ptr, escapes)
@@ -145,23 +234,39 @@ func (parser *Parser) Parse(line string, output ParserResultStorage) error {
 				value = parser.unescape(value, ptr, escapes)
 			}
 
-			output.Store(segment.variable, value)
+			if err := parser.store(output, segment.variable, value); err != nil {
+				return err
+			}
 			ptr = len(line)
 		} else {
-			// Find separator,
-			idx, eidx, escidx, err := segment.searcher.Search(line, ptr, escapes)
+			// Find separator, using the last occurrence before the next anchoring
+			// separator instead of the first occurrence for a "{name*}" variable.
+			var idx, eidx int
+			var err error
+			if segment.greedy {
+				idx, eidx, err = parser.greedySearch(i, ptr, escapes, line)
+			} else {
+				idx, eidx, _, err = segment.searcher.Search(line, ptr, escapes)
+			}
 			if err != nil {
 				return err
 			}
 
 			// Unescape the value only if we skipped over any escapes
+			escidx := 0
+			for escidx < len(escapes) && escapes[escidx][1] <= idx {
+				escidx++
+			}
+
 			value := line[ptr:idx]
 			if escidx > 0 {
 				value = parser.unescape(value, ptr, escapes[0:escidx])
-				escapes = escapes[escidx:]
 			}
+			escapes = escapes[escidx:]
 
-			output.Store(segment.variable, value)
+			if err := parser.store(output, segment.variable, value); err != nil {
+				return err
+			}
 			ptr = eidx
 		}
 	}
@@ -169,6 +274,88 @@ func (parser *Parser) Parse(line string, output ParserResultStorage) error {
 	return nil
 }
 
+// store writes a variable's value to output, converting it to a typed value first
+// when a ValueConverter is registered for key and output implements TypedStorage.
+// With no converter, or a storage that doesn't implement TypedStorage, it falls back
+// to the plain string path.
+func (parser *Parser) store(output ParserResultStorage, key, value string) error {
+	if convert, ok := parser.converters[key]; ok {
+		if typed, ok := output.(TypedStorage); ok {
+			converted, err := convert(value)
+			if err != nil {
+				return fmt.Errorf("converting %s: %w", key, err)
+			}
+
+			typed.StoreTyped(key, converted)
+			return nil
+		}
+	}
+
+	output.Store(key, value)
+	return nil
+}
+
+// greedySearch finds the match for a greedy segment's separator: the last occurrence
+// before the next anchoring separator with a different pattern, reserving one
+// occurrence for every immediately-following segment that shares this separator's
+// pattern (those segments still need an occurrence of their own to match against).
+// Without the reservation, a greedy segment whose separator repeats later in the
+// format (e.g. "{a*}-{b}-{c}") would consume every remaining occurrence of "-" and
+// leave none for "b", turning an otherwise-parseable line into a NO_MATCH.
+func (parser *Parser) greedySearch(i, ptr int, escapes [][]int, line string) (int, int, error) {
+	segment := parser.segments[i]
+	pattern := segment.searcher.pattern
+
+	reserveCount := 0
+	j := i + 1
+	for j < len(parser.segments) && parser.segments[j].searcher != nil && parser.segments[j].searcher.pattern == pattern {
+		reserveCount++
+		j++
+	}
+
+	limit := len(line)
+	if j < len(parser.segments) && parser.segments[j].searcher != nil {
+		if nidx, _, _, err := parser.segments[j].searcher.Search(line, ptr, escapes); err == nil {
+			limit = nidx
+		}
+	}
+
+	// Walk backward one reserved occurrence at a time; the last one found (after
+	// reserveCount+1 reverse searches) is the occurrence that leaves exactly
+	// reserveCount further occurrences available to the segments that need them.
+	var idx, eidx int
+	var err error
+	for k := 0; k <= reserveCount; k++ {
+		idx, eidx, err = segment.searcher.SearchReverse(line, ptr, limit, escapes)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		limit = idx
+	}
+
+	return idx, eidx, nil
+}
+
+func (parser *Parser) parseRegex(line string, output ParserResultStorage) error {
+	match := parser.regexParse.FindStringSubmatch(line)
+	if match == nil {
+		return NO_MATCH
+	}
+
+	for i, name := range parser.regexNames {
+		if name == "" || match[i] == "" {
+			continue
+		}
+
+		if err := parser.store(output, name, match[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (parser *Parser) ParseToMap(line string) (map[string]string, error) {
 	result := make(parserResultMap)
 	err := parser.Parse(line, result)
@@ -214,19 +401,45 @@ type stringSearcher struct {
 	pattern      string
 	badChars     [256]int
 	goodSuffixes []int
+
+	// reverse is a searcher over the reversed pattern, used by SearchReverse to find
+	// the last occurrence of pattern in a line instead of the first.
+	reverse *stringSearcher
 }
 
 func compileSearcher(pattern string) *stringSearcher {
 	result := &stringSearcher{pattern: pattern}
+	result.badChars, result.goodSuffixes = buildSearchTables(pattern)
+
+	result.reverse = &stringSearcher{pattern: reverseString(pattern)}
+	result.reverse.badChars, result.reverse.goodSuffixes = buildSearchTables(result.reverse.pattern)
+
+	return result
+}
+
+func reverseString(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+
+	return string(b)
+}
+
+// buildSearchTables computes the Boyer-Moore bad-character and good-suffix tables
+// for pattern. It's shared by compileSearcher's forward and reverse tables - the
+// reverse tables are simply these same tables computed over the reversed pattern.
+func buildSearchTables(pattern string) ([256]int, []int) {
+	var badChars [256]int
 	length := len(pattern)
 	last := length - 1
 
 	// Bad character rule
 	for i := 0; i < 256; i++ {
-		result.badChars[i] = length
+		badChars[i] = length
 	}
 	for i := 0; i < length; i++ {
-		result.badChars[pattern[i]] = last - i
+		badChars[pattern[i]] = last - i
 	}
 
 	// Good suffix rule - http://www-igm.univ-mlv.fr/~lecroq/string/node14.html
@@ -256,27 +469,27 @@ func compileSearcher(pattern string) *stringSearcher {
 
 	// Build jump table based on matching suffixes, above.
 
-	result.goodSuffixes = make([]int, length)
+	goodSuffixes := make([]int, length)
 	for i := 0; i < length; i++ {
-		result.goodSuffixes[i] = length
+		goodSuffixes[i] = length
 	}
 
 	j := 0
 	for i := last; i >= 0; i-- {
 		if suffixes[i] == i+1 {
 			for ; j < last-i; j++ {
-				if result.goodSuffixes[j] == length {
-					result.goodSuffixes[j] = last - i
+				if goodSuffixes[j] == length {
+					goodSuffixes[j] = last - i
 				}
 			}
 		}
 	}
 
 	for i := 0; i < last; i++ {
-		result.goodSuffixes[last-suffixes[i]] = last - i
+		goodSuffixes[last-suffixes[i]] = last - i
 	}
 
-	return result
+	return badChars, goodSuffixes
 }
 
 func (search *stringSearcher) Search(line string, start int, escapes [][]int) (int, int, int, error) {
@@ -318,3 +531,39 @@ func (search *stringSearcher) Search(line string, start int, escapes [][]int) (i
 
 	return 0, 0, 0, NO_MATCH
 }
+
+// SearchReverse finds the last occurrence of search.pattern within line[start:end),
+// rather than the first occurrence at-or-after start like Search. It mirrors the
+// window and the escapes that fall within it, then delegates to Search on the
+// pre-compiled reverse-pattern searcher so escaped occurrences inside the greedy
+// span are still skipped correctly.
+func (search *stringSearcher) SearchReverse(line string, start, end int, escapes [][]int) (int, int, error) {
+	if end > len(line) {
+		end = len(line)
+	}
+	window := line[start:end]
+
+	var revEscapes [][]int
+	for i := len(escapes) - 1; i >= 0; i-- {
+		escStart, escEnd := escapes[i][0]-start, escapes[i][1]-start
+		if escEnd <= 0 || escStart >= len(window) {
+			continue
+		}
+
+		if escStart < 0 {
+			escStart = 0
+		}
+		if escEnd > len(window) {
+			escEnd = len(window)
+		}
+
+		revEscapes = append(revEscapes, []int{len(window) - escEnd, len(window) - escStart})
+	}
+
+	ridx, reidx, _, err := search.reverse.Search(reverseString(window), 0, revEscapes)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return start + len(window) - reidx, start + len(window) - ridx, nil
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func newGreedyParser(t *testing.T, format string) *Parser {
+	t.Helper()
+
+	parser, err := NewParser(format, &ParserOptions{
+		VariableRegex:  `\{\w+\*?\}`,
+		EscapeRegex:    `\\.`,
+		UnwrapVariable: func(s string) string { return strings.Trim(s, "{}") },
+	})
+	if err != nil {
+		t.Fatalf("NewParser(%q): %v", format, err)
+	}
+
+	return parser
+}
+
+func TestGreedySearchReservesSharedDelimiter(t *testing.T) {
+	parser := newGreedyParser(t, "{a*}-{b}-{c}")
+
+	result, err := parser.ParseToMap("x-y-z-w")
+	if err != nil {
+		t.Fatalf("ParseToMap: %v", err)
+	}
+
+	want := map[string]string{"a": "x-y", "b": "z", "c": "w"}
+	for key, value := range want {
+		if result[key] != value {
+			t.Errorf("result[%q] = %q, want %q", key, result[key], value)
+		}
+	}
+}
+
+func TestGreedySearchStopsAtDifferentDelimiter(t *testing.T) {
+	parser := newGreedyParser(t, "{path*} {query}?{fragment}")
+
+	result, err := parser.ParseToMap("/a/b/c d?frag")
+	if err != nil {
+		t.Fatalf("ParseToMap: %v", err)
+	}
+
+	want := map[string]string{"path": "/a/b/c", "query": "d", "fragment": "frag"}
+	for key, value := range want {
+		if result[key] != value {
+			t.Errorf("result[%q] = %q, want %q", key, result[key], value)
+		}
+	}
+}
+
+func TestParseBytesMatchesParseForGreedySegments(t *testing.T) {
+	parser := newGreedyParser(t, "{a*}-{b}-{c}")
+
+	line := "x-y-z-w"
+	stringResult, err := parser.ParseToMap(line)
+	if err != nil {
+		t.Fatalf("ParseToMap: %v", err)
+	}
+
+	bytesResult := make(parserResultMap)
+	if err := parser.ParseBytes([]byte(line), bytesResult); err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+
+	if len(stringResult) != len(bytesResult) {
+		t.Fatalf("ParseBytes result %v, want to match Parse result %v", bytesResult, stringResult)
+	}
+	for key, value := range stringResult {
+		if bytesResult[key] != value {
+			t.Errorf("ParseBytes result[%q] = %q, want %q (from Parse)", key, bytesResult[key], value)
+		}
+	}
+}
+
+func TestSearchReverseFindsLastOccurrence(t *testing.T) {
+	searcher := compileSearcher("-")
+
+	idx, eidx, err := searcher.SearchReverse("a-b-c-d", 0, 7, nil)
+	if err != nil {
+		t.Fatalf("SearchReverse: %v", err)
+	}
+	if idx != 5 || eidx != 6 {
+		t.Errorf("SearchReverse = (%d, %d), want (5, 6) (the last '-' before 'd')", idx, eidx)
+	}
+}
+
+func TestSearchReverseNoMatchWithinWindow(t *testing.T) {
+	searcher := compileSearcher("-")
+
+	if _, _, err := searcher.SearchReverse("abcdef", 0, 6, nil); err != NO_MATCH {
+		t.Fatalf("SearchReverse: got err %v, want NO_MATCH", err)
+	}
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestRegexParserNamedCaptures(t *testing.T) {
+	parser, err := NewRegexParser(`^(?P<host>\S+) - - \[(?P<time>[^\]]+)\] "(?P<method>\S+) (?P<path>\S+)`, nil)
+	if err != nil {
+		t.Fatalf("NewRegexParser: %v", err)
+	}
+
+	result, err := parser.ParseToMap(`10.0.0.1 - - [10/Oct/2023:13:55:36] "GET /index.html HTTP/1.1" 200`)
+	if err != nil {
+		t.Fatalf("ParseToMap: %v", err)
+	}
+
+	expected := map[string]string{
+		"host":   "10.0.0.1",
+		"time":   "10/Oct/2023:13:55:36",
+		"method": "GET",
+		"path":   "/index.html",
+	}
+	for key, value := range expected {
+		if result[key] != value {
+			t.Errorf("result[%q] = %q, want %q", key, result[key], value)
+		}
+	}
+}
+
+func TestRegexParserNoMatch(t *testing.T) {
+	parser, err := NewRegexParser(`^(?P<host>\S+) ERROR`, nil)
+	if err != nil {
+		t.Fatalf("NewRegexParser: %v", err)
+	}
+
+	if _, err := parser.ParseToMap("10.0.0.1 INFO all good"); err != NO_MATCH {
+		t.Fatalf("ParseToMap: got err %v, want NO_MATCH", err)
+	}
+}
+
+func TestRegexParserSkipsUnnamedAndEmptyGroups(t *testing.T) {
+	parser, err := NewRegexParser(`^(?P<a>\S+)(?: (\S+))?(?: (?P<c>\S+))?$`, nil)
+	if err != nil {
+		t.Fatalf("NewRegexParser: %v", err)
+	}
+
+	result, err := parser.ParseToMap("first third")
+	if err != nil {
+		t.Fatalf("ParseToMap: %v", err)
+	}
+
+	if result["a"] != "first" {
+		t.Errorf(`result["a"] = %q, want "first"`, result["a"])
+	}
+	if _, ok := result["c"]; ok {
+		t.Errorf(`result["c"] = %q, want unset (unmatched optional group)`, result["c"])
+	}
+	if len(result) != 1 {
+		t.Errorf("result = %v, want exactly one key (unnamed group must not be stored)", result)
+	}
+}
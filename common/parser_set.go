@@ -0,0 +1,187 @@
+package common
+
+// ParserSet holds many compiled Parsers and picks the right one for a given line
+// without trying them one at a time. Trying every registered Parser's Boyer-Moore
+// Parse in turn is O(N*M*len(line)) once more than a handful of formats are
+// registered (the common case when a log forwarder ingests rsyslog, nginx, IIS, etc.
+// side by side). Instead, ParserSet builds a single Aho-Corasick automaton out of the
+// literal separator text of every Parser's segments, so one linear scan of the line
+// locates every separator occurrence across all formats at once. A Parser is only
+// handed to its real Parse once its separators are confirmed to occur, in order, in
+// the line - Match uses the scan purely as a prefilter.
+type ParserSet struct {
+	parsers        []*Parser
+	root           *acNode
+	literalCount   int
+	parserLiterals [][]int
+}
+
+type acNode struct {
+	children map[byte]*acNode
+	fail     *acNode
+	output   []int
+}
+
+// NewParserSet builds the Aho-Corasick automaton for the given parsers. Parsers built
+// with NewRegexParser (which have no literal separators) are always treated as
+// candidates and fall through to their own Parse.
+func NewParserSet(parsers ...*Parser) *ParserSet {
+	root := &acNode{children: make(map[byte]*acNode)}
+	literalIDs := make(map[string]int)
+	var parserLiterals [][]int
+
+	for _, parser := range parsers {
+		var order []int
+		for _, segment := range parser.segments {
+			if segment.searcher == nil || segment.searcher.pattern == "" {
+				continue
+			}
+
+			pattern := segment.searcher.pattern
+			id, ok := literalIDs[pattern]
+			if !ok {
+				id = len(literalIDs)
+				literalIDs[pattern] = id
+				root.insert(pattern, id)
+			}
+
+			order = append(order, id)
+		}
+
+		parserLiterals = append(parserLiterals, order)
+	}
+
+	root.buildFailureLinks()
+
+	return &ParserSet{
+		parsers:        parsers,
+		root:           root,
+		literalCount:   len(literalIDs),
+		parserLiterals: parserLiterals,
+	}
+}
+
+// Match scans line once against the combined automaton, then confirms each candidate
+// parser (one whose literal anchors all occur, in order) with its own Parse. It
+// returns the first parser that actually matches, along with its parsed result.
+func (set *ParserSet) Match(line string) (*Parser, ParserResultStorage, error) {
+	positions := set.scan(line)
+
+	for i, parser := range set.parsers {
+		if !isCandidate(set.parserLiterals[i], positions) {
+			continue
+		}
+
+		result := make(parserResultMap)
+		if err := parser.Parse(line, result); err == nil {
+			return parser, result, nil
+		}
+	}
+
+	return nil, nil, NO_MATCH
+}
+
+// scan runs the line through the automaton once, returning, for each literal ID, the
+// ordered list of positions (one past the last matched byte) where it occurred.
+func (set *ParserSet) scan(line string) [][]int {
+	positions := make([][]int, set.literalCount)
+
+	node := set.root
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		for node != set.root {
+			if _, ok := node.children[c]; ok {
+				break
+			}
+			node = node.fail
+		}
+
+		if next, ok := node.children[c]; ok {
+			node = next
+		}
+
+		for _, id := range node.output {
+			positions[id] = append(positions[id], i+1)
+		}
+	}
+
+	return positions
+}
+
+// isCandidate reports whether literals (a parser's ordered separator anchors) has a
+// monotonically increasing occurrence sequence in positions.
+func isCandidate(literals []int, positions [][]int) bool {
+	ptr := 0
+
+	for _, id := range literals {
+		found := false
+		for _, pos := range positions[id] {
+			if pos > ptr {
+				ptr = pos
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (node *acNode) insert(pattern string, id int) {
+	cur := node
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		next, ok := cur.children[c]
+		if !ok {
+			next = &acNode{children: make(map[byte]*acNode)}
+			cur.children[c] = next
+		}
+		cur = next
+	}
+
+	cur.output = append(cur.output, id)
+}
+
+// buildFailureLinks computes each node's failure link by BFS: a node's failure
+// pointer is the deepest proper suffix of its prefix that is also a trie prefix.
+// Output lists are extended along the failure chain so a match ending at a node also
+// reports any literal that matches at that position via a shorter suffix.
+func (root *acNode) buildFailureLinks() {
+	root.fail = root
+
+	var queue []*acNode
+	for _, child := range root.children {
+		child.fail = root
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for c, child := range cur.children {
+			queue = append(queue, child)
+
+			f := cur.fail
+			for f != root {
+				if _, ok := f.children[c]; ok {
+					break
+				}
+				f = f.fail
+			}
+
+			if next, ok := f.children[c]; ok && next != child {
+				child.fail = next
+			} else {
+				child.fail = root
+			}
+
+			child.output = append(child.output, child.fail.output...)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParser(t *testing.T, format string) *Parser {
+	t.Helper()
+
+	parser, err := NewParser(format, &ParserOptions{
+		VariableRegex:  `\{\w+\*?\}`,
+		EscapeRegex:    `\\.`,
+		UnwrapVariable: func(s string) string { return strings.Trim(s, "{}") },
+	})
+	if err != nil {
+		t.Fatalf("NewParser(%q): %v", format, err)
+	}
+
+	return parser
+}
+
+func TestParserSetMatchPicksCandidateParser(t *testing.T) {
+	nginx := mustParser(t, "{ip} - - [{time}]")
+	syslog := mustParser(t, "{month} {day} {host}:")
+
+	set := NewParserSet(nginx, syslog)
+
+	parser, result, err := set.Match("10.0.0.1 - - [10/Oct/2023]")
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	if parser != nginx {
+		t.Fatalf("Match picked %v, want nginx parser", parser)
+	}
+	if got := result.(parserResultMap)["ip"]; got != "10.0.0.1" {
+		t.Errorf(`result["ip"] = %q, want "10.0.0.1"`, got)
+	}
+
+	parser, result, err = set.Match("Oct 10 myhost:")
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	if parser != syslog {
+		t.Fatalf("Match picked %v, want syslog parser", parser)
+	}
+	if got := result.(parserResultMap)["host"]; got != "myhost" {
+		t.Errorf(`result["host"] = %q, want "myhost"`, got)
+	}
+}
+
+func TestParserSetMatchNoneMatch(t *testing.T) {
+	nginx := mustParser(t, "{ip} - - [{time}]")
+	set := NewParserSet(nginx)
+
+	if _, _, err := set.Match("this line matches nothing"); err != NO_MATCH {
+		t.Fatalf("Match: got err %v, want NO_MATCH", err)
+	}
+}
+
+// TestParserSetOverlappingLiterals mirrors the classic Aho-Corasick textbook example
+// (patterns "he", "she", "his", "hers" over text "ushers") to exercise failure links
+// that traverse through a node whose own prefix is itself a suffix of another pattern.
+func TestParserSetOverlappingLiterals(t *testing.T) {
+	root := &acNode{children: make(map[byte]*acNode)}
+	ids := map[string]int{"he": 0, "she": 1, "his": 2, "hers": 3}
+	for pattern, id := range ids {
+		root.insert(pattern, id)
+	}
+	root.buildFailureLinks()
+
+	set := &ParserSet{root: root, literalCount: len(ids)}
+	positions := set.scan("ushers")
+
+	// Positions are one past the last matched byte: "she" ends at 4, "he" ends at 4
+	// (via she's failure link), "hers" ends at 6.
+	if !containsInt(positions[ids["she"]], 4) {
+		t.Errorf("she occurrences = %v, want to include 4", positions[ids["she"]])
+	}
+	if !containsInt(positions[ids["he"]], 4) {
+		t.Errorf("he occurrences = %v, want to include 4 (via she's failure link)", positions[ids["he"]])
+	}
+	if !containsInt(positions[ids["hers"]], 6) {
+		t.Errorf("hers occurrences = %v, want to include 6", positions[ids["hers"]])
+	}
+	if len(positions[ids["his"]]) != 0 {
+		t.Errorf("his occurrences = %v, want none", positions[ids["his"]])
+	}
+}
+
+func TestIsCandidateRequiresIncreasingOccurrences(t *testing.T) {
+	positions := [][]int{
+		{2}, // literal 0 occurs at 2
+		{3}, // literal 1 occurs at 3
+	}
+
+	if !isCandidate([]int{0, 1}, positions) {
+		t.Error("isCandidate([0,1]) = false, want true (0@2 then 1@3 is increasing)")
+	}
+	if isCandidate([]int{1, 0}, positions) {
+		t.Error("isCandidate([1,0]) = true, want false (1@3 has no later occurrence of 0)")
+	}
+}
+
+func containsInt(haystack []int, needle int) bool {
+	for _, v := range haystack {
+		if v == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// ParseStream reads log input incrementally from r, one line at a time, and invokes
+// out with the parse result for each line. It reuses a single parserResultMap across
+// lines to avoid a per-line allocation; callers that need to retain a result past the
+// out call must copy it themselves, since the map is cleared and reused on the next
+// line.
+//
+// A line that fails to parse (including an ordinary NO_MATCH) does not abort the
+// stream: out is still called with that line's result and the error, so the
+// caller can decide whether to skip it, log it, or stop - the same per-line decision
+// Parse and ParseBytes already leave to their caller. That result holds whatever
+// variables were stored before the failure, so it may be partial rather than empty.
+// Only a genuine read error from r, reported via the final return value, ends the
+// stream early.
+func (parser *Parser) ParseStream(r io.Reader, out func(ParserResultStorage, error)) error {
+	scanner := bufio.NewScanner(r)
+	if parser.maxScanTokenSize > 0 {
+		// bufio.Scanner.Buffer's effective max is max(maxScanTokenSize, cap(buf)), so
+		// the initial buffer must never be given more capacity than the requested
+		// max - otherwise a small MaxScanTokenSize is silently overridden by it.
+		initial := parser.maxScanTokenSize
+		if initial > 64*1024 {
+			initial = 64 * 1024
+		}
+
+		buf := make([]byte, 0, initial)
+		scanner.Buffer(buf, parser.maxScanTokenSize)
+	}
+
+	result := make(parserResultMap)
+	for scanner.Scan() {
+		for key := range result {
+			delete(result, key)
+		}
+
+		err := parser.ParseBytes(scanner.Bytes(), result)
+		out(result, err)
+	}
+
+	return scanner.Err()
+}
+
+// ParseBytes is the []byte-native counterpart to Parse. It avoids the string(...)
+// conversion of the whole input line that Parse requires, only converting the
+// substrings that are actually stored as variable values. The exception is a format
+// with a greedy ("{name*}") variable, for which the whole line is converted once.
+func (parser *Parser) ParseBytes(line []byte, output ParserResultStorage) error {
+	if parser.regexParse != nil {
+		return parser.parseRegexBytes(line, output)
+	}
+
+	// First, find all of the escape sequences in the input so we can skip over them
+	// when processing the line.
+	escapes := parser.escapeRE.FindAllIndex(line, -1)
+
+	// Greedy segments fall back to the string-based searcher (there's no byte-native
+	// reverse Boyer-Moore table), converting the line lazily and only if the format
+	// actually has a greedy variable.
+	var lineStr string
+	var haveLineStr bool
+
+	ptr := 0
+	for i, segment := range parser.segments {
+		if segment.variable == "" {
+			// Look for a delimiter at the beginning, don't read into a variable
+			_, eidx, escidx, err := segment.searcher.SearchBytes(line, ptr, escapes)
+			if err != nil {
+				return err
+			}
+
+			ptr = eidx
+			escapes = escapes[escidx:]
+		} else if segment.searcher == nil {
+			// Read the rest of the line into a variable
+			value := line[ptr:]
+			var str string
+			if len(escapes) > 0 {
+				str = parser.unescapeBytes(value, ptr, escapes)
+			} else {
+				str = string(value)
+			}
+
+			if err := parser.store(output, segment.variable, str); err != nil {
+				return err
+			}
+			ptr = len(line)
+		} else {
+			// Find separator, using the last occurrence before the next anchoring
+			// separator instead of the first occurrence for a "{name*}" variable.
+			var idx, eidx int
+			var err error
+			if segment.greedy {
+				if !haveLineStr {
+					lineStr = string(line)
+					haveLineStr = true
+				}
+
+				idx, eidx, err = parser.greedySearch(i, ptr, escapes, lineStr)
+			} else {
+				idx, eidx, _, err = segment.searcher.SearchBytes(line, ptr, escapes)
+			}
+			if err != nil {
+				return err
+			}
+
+			// Unescape the value only if we skipped over any escapes
+			escidx := 0
+			for escidx < len(escapes) && escapes[escidx][1] <= idx {
+				escidx++
+			}
+
+			value := line[ptr:idx]
+			var str string
+			if escidx > 0 {
+				str = parser.unescapeBytes(value, ptr, escapes[0:escidx])
+			} else {
+				str = string(value)
+			}
+			escapes = escapes[escidx:]
+
+			if err := parser.store(output, segment.variable, str); err != nil {
+				return err
+			}
+			ptr = eidx
+		}
+	}
+
+	return nil
+}
+
+func (parser *Parser) parseRegexBytes(line []byte, output ParserResultStorage) error {
+	match := parser.regexParse.FindSubmatch(line)
+	if match == nil {
+		return NO_MATCH
+	}
+
+	for i, name := range parser.regexNames {
+		if name == "" || len(match[i]) == 0 {
+			continue
+		}
+
+		if err := parser.store(output, name, string(match[i])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (parser *Parser) unescapeBytes(match []byte, offset int, escapes [][]int) string {
+	var buf bytes.Buffer
+	last := 0
+
+	for _, esc := range escapes {
+		// Get escape relative to offset
+		escStart := esc[0] - offset
+		escEnd := esc[1] - offset
+
+		// Write last-escape start into buffer
+		buf.Write(match[last:escStart])
+
+		// Unescape into buffer
+		parser.unescapeCallback(string(match[escStart:escEnd]), &buf)
+
+		// Advance last pointer
+		last = escEnd
+	}
+
+	// Write remainder of string
+	buf.Write(match[last:])
+
+	return buf.String()
+}
+
+// SearchBytes is the []byte-native counterpart to Search, used by ParseBytes so a
+// caller with a []byte input doesn't have to materialize the whole line as a string
+// up front.
+func (search *stringSearcher) SearchBytes(line []byte, start int, escapes [][]int) (int, int, int, error) {
+	escidx := 0
+
+	for i := start; i <= len(line)-len(search.pattern); {
+		j := len(search.pattern) - 1
+
+		// Skip over escapes we've already passed
+		for escidx < len(escapes) && escapes[escidx][1] <= i {
+			escidx++
+		}
+
+		// Skip i over the next escape if we're in the middle of it
+		if escidx < len(escapes) && escapes[escidx][0] <= (j+i) {
+			i = escapes[escidx][1]
+			continue
+		}
+
+		// Perform check
+		for j >= 0 && search.pattern[j] == line[i+j] {
+			j--
+		}
+		if j < 0 {
+			// Matched
+			return i, i + len(search.pattern), escidx, nil
+		}
+
+		// No match
+		bc := search.badChars[line[i+j]] - len(search.pattern) + 1 + j
+		gs := search.goodSuffixes[j]
+
+		if bc > gs {
+			i += bc
+		} else {
+			i += gs
+		}
+	}
+
+	return 0, 0, 0, NO_MATCH
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func newLineParser(t *testing.T) *Parser {
+	t.Helper()
+
+	parser, err := NewParser("{word} ", &ParserOptions{
+		VariableRegex:  `\{\w+\*?\}`,
+		EscapeRegex:    `\\.`,
+		UnwrapVariable: func(s string) string { return strings.Trim(s, "{}") },
+	})
+	if err != nil {
+		t.Fatalf("NewParser: %v", err)
+	}
+
+	return parser
+}
+
+func TestParseStreamSkipsBadLines(t *testing.T) {
+	parser := newLineParser(t)
+
+	input := "good one\nBADLINE\nafter good two\n"
+
+	var values []string
+	var errs []error
+	err := parser.ParseStream(strings.NewReader(input), func(result ParserResultStorage, err error) {
+		errs = append(errs, err)
+		if err == nil {
+			values = append(values, result.(parserResultMap)["word"])
+		}
+	})
+	if err != nil {
+		t.Fatalf("ParseStream: %v", err)
+	}
+
+	if len(errs) != 3 {
+		t.Fatalf("got %d callbacks, want 3 (one per line)", len(errs))
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("errs = %v, want nil for the two good lines", errs)
+	}
+	if errs[1] != NO_MATCH {
+		t.Errorf("errs[1] = %v, want NO_MATCH", errs[1])
+	}
+
+	want := []string{"good", "after"}
+	if len(values) != len(want) {
+		t.Fatalf("values = %v, want %v", values, want)
+	}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Errorf("values[%d] = %q, want %q", i, values[i], want[i])
+		}
+	}
+}
+
+func TestParseStreamHonorsMaxScanTokenSize(t *testing.T) {
+	parser, err := NewParser("{word} ", &ParserOptions{
+		VariableRegex:    `\{\w+\*?\}`,
+		EscapeRegex:      `\\.`,
+		UnwrapVariable:   func(s string) string { return strings.Trim(s, "{}") },
+		MaxScanTokenSize: 100,
+	})
+	if err != nil {
+		t.Fatalf("NewParser: %v", err)
+	}
+
+	longLine := strings.Repeat("x", 4000) + "\n"
+	err = parser.ParseStream(strings.NewReader(longLine), func(result ParserResultStorage, err error) {})
+	if err == nil {
+		t.Fatal("ParseStream: got nil error, want a token-too-long error from the scanner")
+	}
+	if !strings.Contains(err.Error(), "too long") {
+		t.Errorf("ParseStream: err = %v, want a \"token too long\" error", err)
+	}
+}
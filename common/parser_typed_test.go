@@ -0,0 +1,132 @@
+package common
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type typedResultMap struct {
+	parserResultMap
+	typed map[string]interface{}
+}
+
+func newTypedResultMap() *typedResultMap {
+	return &typedResultMap{
+		parserResultMap: make(parserResultMap),
+		typed:           make(map[string]interface{}),
+	}
+}
+
+func (m *typedResultMap) StoreTyped(key string, value interface{}) {
+	m.typed[key] = value
+}
+
+func intConverter(s string) (interface{}, error) {
+	return strconv.Atoi(s)
+}
+
+func TestParseStoresTypedValueWhenConverterAndTypedStorageBothPresent(t *testing.T) {
+	parser, err := NewParser("{n}", &ParserOptions{
+		VariableRegex:  `\{\w+\*?\}`,
+		EscapeRegex:    `\\.`,
+		UnwrapVariable: func(s string) string { return strings.Trim(s, "{}") },
+		Converters:     map[string]ValueConverter{"n": intConverter},
+	})
+	if err != nil {
+		t.Fatalf("NewParser: %v", err)
+	}
+
+	result := newTypedResultMap()
+	if err := parser.Parse("42", result); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if result.typed["n"] != 42 {
+		t.Errorf(`typed["n"] = %v, want 42`, result.typed["n"])
+	}
+	if _, ok := result.parserResultMap["n"]; ok {
+		t.Errorf("plain string Store was also called for a converted value")
+	}
+}
+
+func TestParseFallsBackToStringWithoutTypedStorage(t *testing.T) {
+	parser, err := NewParser("{n}", &ParserOptions{
+		VariableRegex:  `\{\w+\*?\}`,
+		EscapeRegex:    `\\.`,
+		UnwrapVariable: func(s string) string { return strings.Trim(s, "{}") },
+		Converters:     map[string]ValueConverter{"n": intConverter},
+	})
+	if err != nil {
+		t.Fatalf("NewParser: %v", err)
+	}
+
+	result := make(parserResultMap)
+	if err := parser.Parse("42", result); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if result["n"] != "42" {
+		t.Errorf(`result["n"] = %q, want "42" (no TypedStorage, so the converter must not run)`, result["n"])
+	}
+}
+
+func TestParseWrapsConverterError(t *testing.T) {
+	parser, err := NewParser("{n}", &ParserOptions{
+		VariableRegex:  `\{\w+\*?\}`,
+		EscapeRegex:    `\\.`,
+		UnwrapVariable: func(s string) string { return strings.Trim(s, "{}") },
+		Converters:     map[string]ValueConverter{"n": intConverter},
+	})
+	if err != nil {
+		t.Fatalf("NewParser: %v", err)
+	}
+
+	result := newTypedResultMap()
+	err = parser.Parse("not-a-number", result)
+	if err == nil {
+		t.Fatal("Parse: got nil error, want the wrapped converter error")
+	}
+	if !strings.Contains(err.Error(), "n") {
+		t.Errorf("Parse: err = %v, want it to name the variable", err)
+	}
+
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Errorf("Parse: err = %v, want it to wrap the original *strconv.NumError", err)
+	}
+}
+
+func TestRegexParserUsesConverters(t *testing.T) {
+	parser, err := NewRegexParser(`^(?P<n>\d+)$`, &ParserOptions{
+		Converters: map[string]ValueConverter{"n": intConverter},
+	})
+	if err != nil {
+		t.Fatalf("NewRegexParser: %v", err)
+	}
+
+	result := newTypedResultMap()
+	if err := parser.Parse("7", result); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if result.typed["n"] != 7 {
+		t.Errorf(`typed["n"] = %v, want 7`, result.typed["n"])
+	}
+}
+
+func TestRegexParserWithNilOptions(t *testing.T) {
+	parser, err := NewRegexParser(`^(?P<n>\d+)$`, nil)
+	if err != nil {
+		t.Fatalf("NewRegexParser: %v", err)
+	}
+
+	result, err := parser.ParseToMap("7")
+	if err != nil {
+		t.Fatalf("ParseToMap: %v", err)
+	}
+	if result["n"] != "7" {
+		t.Errorf(`result["n"] = %q, want "7"`, result["n"])
+	}
+}